@@ -0,0 +1,121 @@
+// Package bus はメモリ空間・I/Oポート空間へのアクセスを、フラットな
+// メモリ配列ではなくプラガブルなデバイスへのディスパッチとして扱う。
+package bus
+
+import "fmt"
+
+// MemDevice はメモリ空間の一部にマップされるデバイスが実装するインターフェース。
+type MemDevice interface {
+	Read8(addr uint32) uint8
+	Write8(addr uint32, value uint8)
+}
+
+// PortDevice はI/Oポート空間にマップされるデバイスが実装するインターフェース。
+type PortDevice interface {
+	In8(port uint16) uint8
+	Out8(port uint16, value uint8)
+}
+
+type memRegion struct {
+	start, end uint32
+	dev        MemDevice
+}
+
+// Bus はメモリ/I/Oポートアクセスをデバイスに振り分ける。どのデバイスにも
+// マップされていないメモリアドレスへのアクセスは、内蔵のフラットなRAMを
+// バッキングストアとして扱う。
+type Bus struct {
+	regions []memRegion
+	ports   map[uint16]PortDevice
+	ram     []uint8
+}
+
+// New はsize バイトのRAMをバッキングストアとするBusを作る。
+func New(size uint32) *Bus {
+	return &Bus{ram: make([]uint8, size), ports: make(map[uint16]PortDevice)}
+}
+
+// MapMem はdevを[start, end)のメモリ範囲にマップする。
+func (b *Bus) MapMem(start, end uint32, dev MemDevice) {
+	b.regions = append(b.regions, memRegion{start, end, dev})
+}
+
+// MapPort はdevをI/Oポートportにマップする。
+func (b *Bus) MapPort(port uint16, dev PortDevice) {
+	b.ports[port] = dev
+}
+
+func (b *Bus) findMem(addr uint32) MemDevice {
+	for _, r := range b.regions {
+		if addr >= r.start && addr < r.end {
+			return r.dev
+		}
+	}
+	return nil
+}
+
+// Size はバッキングRAMのバイト数を返す。
+func (b *Bus) Size() uint32 {
+	return uint32(len(b.ram))
+}
+
+// LoadROM はバッキングRAMのaddress以降にdataをコピーする。起動イメージの
+// 読み込みや、JSONマップで指定されたROM領域の読み込みに使う。addressから
+// data分がバッキングRAMの範囲に収まらない場合はエラーを返す。
+func (b *Bus) LoadROM(address uint32, data []uint8) error {
+	end := uint64(address) + uint64(len(data))
+	if end > uint64(len(b.ram)) {
+		return fmt.Errorf("bus: LoadROM at 0x%x (%d bytes) exceeds RAM size %d", address, len(data), len(b.ram))
+	}
+	copy(b.ram[address:], data)
+	return nil
+}
+
+func (b *Bus) Read8(addr uint32) uint8 {
+	if dev := b.findMem(addr); dev != nil {
+		return dev.Read8(addr)
+	}
+	return b.ram[addr]
+}
+
+func (b *Bus) Write8(addr uint32, value uint8) {
+	if dev := b.findMem(addr); dev != nil {
+		dev.Write8(addr, value)
+		return
+	}
+	b.ram[addr] = value
+}
+
+func (b *Bus) Read16(addr uint32) uint16 {
+	return uint16(b.Read8(addr)) | uint16(b.Read8(addr+1))<<8
+}
+
+func (b *Bus) Write16(addr uint32, value uint16) {
+	b.Write8(addr, uint8(value))
+	b.Write8(addr+1, uint8(value>>8))
+}
+
+func (b *Bus) Read32(addr uint32) uint32 {
+	return uint32(b.Read8(addr)) | uint32(b.Read8(addr+1))<<8 |
+		uint32(b.Read8(addr+2))<<16 | uint32(b.Read8(addr+3))<<24
+}
+
+func (b *Bus) Write32(addr uint32, value uint32) {
+	b.Write8(addr, uint8(value))
+	b.Write8(addr+1, uint8(value>>8))
+	b.Write8(addr+2, uint8(value>>16))
+	b.Write8(addr+3, uint8(value>>24))
+}
+
+func (b *Bus) In8(port uint16) uint8 {
+	if dev, ok := b.ports[port]; ok {
+		return dev.In8(port)
+	}
+	return 0
+}
+
+func (b *Bus) Out8(port uint16, value uint8) {
+	if dev, ok := b.ports[port]; ok {
+		dev.Out8(port, value)
+	}
+}
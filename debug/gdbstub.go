@@ -0,0 +1,335 @@
+// Package debug は GDB Remote Serial Protocol を話す最小限のスタブを
+// 実装する。`gdb -ex 'target remote :1234'` で接続し、16ビットのブート
+// コードなどをステップ実行・ブレークポイントで追えるようにするための
+// ものであり、仕様全体ではなく対話的デバッグに最低限必要なパケットだけを
+// サポートする。
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"otyaken/go-x86-emu/emu"
+)
+
+// gpRegIndex はGDBの'g'/'G'パケットで使われるi386の汎用レジスタの並び順。
+var gpRegIndex = []uint8{emu.CEax, emu.CEcx, emu.CEdx, emu.CEbx, emu.CEsp, emu.CEbp, emu.CEsi, emu.CEdi}
+
+// Serve はaddr（例: ":1234"）でリッスンし、1接続分のGDBセッションを処理する。
+func Serve(addr string, e *emu.Emulator, quiet bool) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	log.Printf("gdbstub: listening on %s\n", addr)
+
+	conn, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s := &session{emu: e, conn: conn, r: bufio.NewReader(conn), quiet: quiet}
+	return s.loop()
+}
+
+type session struct {
+	emu   *emu.Emulator
+	conn  net.Conn
+	r     *bufio.Reader
+	quiet bool
+}
+
+func (s *session) loop() error {
+	for {
+		packet, ok, err := s.readPacket()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// チェックサムが合わないパケットは'-'でNACKし、GDB側の
+			// 再送に任せる。データは破棄して処理しない。
+			if _, err := s.conn.Write([]byte("-")); err != nil {
+				return err
+			}
+			continue
+		}
+		// 有効なパケットを受け取ったことを示す'+'を返す。
+		if _, err := s.conn.Write([]byte("+")); err != nil {
+			return err
+		}
+		s.writePacket(s.handle(packet))
+	}
+}
+
+// readPacket は`$data#cksum`形式の次のパケットを読み取り、dataとチェック
+// サムが一致したかどうかを返す。先頭の'+'/'-'（前回の応答へのACK/NACK）
+// は読み捨てる。cksumはdataの8bit和をmod 256した小文字16進数2桁。
+func (s *session) readPacket() (string, bool, error) {
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return "", false, err
+		}
+		if b == '$' {
+			break
+		}
+	}
+	var data []byte
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return "", false, err
+		}
+		if b == '#' {
+			break
+		}
+		data = append(data, b)
+	}
+	hi, err := s.r.ReadByte()
+	if err != nil {
+		return "", false, err
+	}
+	lo, err := s.r.ReadByte()
+	if err != nil {
+		return "", false, err
+	}
+	want, err := strconv.ParseUint(string([]byte{hi, lo}), 16, 8)
+	if err != nil {
+		return "", false, nil
+	}
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return string(data), sum == byte(want), nil
+}
+
+func (s *session) writePacket(data string) {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	fmt.Fprintf(s.conn, "$%s#%02x", data, sum)
+}
+
+func (s *session) handle(packet string) string {
+	if packet == "" {
+		return ""
+	}
+	switch packet[0] {
+	case '?':
+		return "S05"
+	case 'g':
+		return s.readRegisters()
+	case 'G':
+		s.writeRegisters(packet[1:])
+		return "OK"
+	case 'p':
+		return s.readRegister(packet[1:])
+	case 'P':
+		return s.writeRegister(packet[1:])
+	case 'm':
+		return s.readMemory(packet[1:])
+	case 'M':
+		return s.writeMemory(packet[1:])
+	case 'c':
+		s.emu.RunCycles(s.quiet, ^uint64(0))
+		return "S05"
+	case 's':
+		s.emu.Step(s.quiet)
+		return "S05"
+	case 'Z':
+		return s.setBreakpoint(packet[1:])
+	case 'z':
+		return s.clearBreakpoint(packet[1:])
+	case 'q':
+		if strings.HasPrefix(packet, "qSupported") {
+			return "PacketSize=1000"
+		}
+		return ""
+	}
+	return ""
+}
+
+// readRegisters はi386の'g'パケットの並び順（eax..edi, eip, eflags,
+// cs, ss, ds, es, fs, gs）で全レジスタをリトルエンディアン16進文字列にする。
+// セグメントレジスタはこのエミュレータでは扱っていないため常に0を返す。
+func (s *session) readRegisters() string {
+	var b strings.Builder
+	for _, idx := range gpRegIndex {
+		b.WriteString(leHex32(s.emu.Registers[idx]))
+	}
+	b.WriteString(leHex32(s.emu.Eip))
+	b.WriteString(leHex32(s.emu.Eflags))
+	for i := 0; i < 6; i++ {
+		b.WriteString(leHex32(0))
+	}
+	return b.String()
+}
+
+func (s *session) writeRegisters(hexData string) {
+	pos := 0
+	for _, idx := range gpRegIndex {
+		if pos+8 > len(hexData) {
+			return
+		}
+		s.emu.Registers[idx] = parseLEHex32(hexData[pos : pos+8])
+		pos += 8
+	}
+	if pos+8 <= len(hexData) {
+		s.emu.Eip = parseLEHex32(hexData[pos : pos+8])
+		pos += 8
+	}
+	if pos+8 <= len(hexData) {
+		s.emu.Eflags = parseLEHex32(hexData[pos : pos+8])
+	}
+}
+
+// readRegister はGDBのレジスタ番号（0-7がeax..edi、8がeip、9がeflags、
+// 10-15がセグメントレジスタ）を1つ読み取る。
+func (s *session) readRegister(arg string) string {
+	n, err := strconv.ParseUint(arg, 16, 8)
+	if err != nil {
+		return "E01"
+	}
+	switch {
+	case n < 8:
+		return leHex32(s.emu.Registers[gpRegIndex[n]])
+	case n == 8:
+		return leHex32(s.emu.Eip)
+	case n == 9:
+		return leHex32(s.emu.Eflags)
+	default:
+		return leHex32(0)
+	}
+}
+
+func (s *session) writeRegister(arg string) string {
+	n, value, ok := splitRegAssign(arg)
+	if !ok {
+		return "E01"
+	}
+	switch {
+	case n < 8:
+		s.emu.Registers[gpRegIndex[n]] = value
+	case n == 8:
+		s.emu.Eip = value
+	case n == 9:
+		s.emu.Eflags = value
+	}
+	return "OK"
+}
+
+func splitRegAssign(arg string) (n uint64, value uint32, ok bool) {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	n, err := strconv.ParseUint(parts[0], 16, 8)
+	if err != nil || len(parts[1]) < 8 {
+		return 0, 0, false
+	}
+	return n, parseLEHex32(parts[1]), true
+}
+
+// readMemory はEmulator.Busから'm addr,length'パケットの範囲を読み出す。
+func (s *session) readMemory(arg string) string {
+	addr, length, err := parseAddrLen(arg)
+	if err != nil || uint64(addr)+uint64(length) > uint64(s.emu.Bus.Size()) {
+		return "E01"
+	}
+	var b strings.Builder
+	for i := uint32(0); i < length; i++ {
+		fmt.Fprintf(&b, "%02x", s.emu.Bus.Read8(addr+i))
+	}
+	return b.String()
+}
+
+// writeMemory は'M addr,length:data'パケットの内容をEmulator.Busに書き込む。
+func (s *session) writeMemory(arg string) string {
+	head, data, ok := strings.Cut(arg, ":")
+	if !ok {
+		return "E01"
+	}
+	addr, length, err := parseAddrLen(head)
+	if err != nil || uint64(addr)+uint64(length) > uint64(s.emu.Bus.Size()) || uint32(len(data)) < length*2 {
+		return "E01"
+	}
+	for i := uint32(0); i < length; i++ {
+		v, err := strconv.ParseUint(data[i*2:i*2+2], 16, 8)
+		if err != nil {
+			return "E01"
+		}
+		s.emu.WriteMemory8(addr+i, uint8(v))
+	}
+	return "OK"
+}
+
+func parseAddrLen(s string) (addr, length uint32, err error) {
+	parts := strings.SplitN(s, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("bad addr,length %q", s)
+	}
+	a, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	l, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint32(a), uint32(l), nil
+}
+
+// setBreakpoint/clearBreakpoint は'Z0,addr,kind'/'z0,addr,kind'を扱う。
+// kindは無視し、ソフトウェアブレークポイントとしてのみ扱う。
+func (s *session) setBreakpoint(arg string) string {
+	addr, ok := parseBreakpointAddr(arg)
+	if !ok {
+		return ""
+	}
+	s.emu.SetBreakpoint(addr)
+	return "OK"
+}
+
+func (s *session) clearBreakpoint(arg string) string {
+	addr, ok := parseBreakpointAddr(arg)
+	if !ok {
+		return ""
+	}
+	s.emu.ClearBreakpoint(addr)
+	return "OK"
+}
+
+func parseBreakpointAddr(arg string) (uint32, bool) {
+	if !strings.HasPrefix(arg, "0,") {
+		return 0, false
+	}
+	parts := strings.Split(arg, ",")
+	if len(parts) < 2 {
+		return 0, false
+	}
+	addr, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(addr), true
+}
+
+func leHex32(v uint32) string {
+	return fmt.Sprintf("%02x%02x%02x%02x", v&0xff, (v>>8)&0xff, (v>>16)&0xff, (v>>24)&0xff)
+}
+
+func parseLEHex32(hexData string) uint32 {
+	var bytes [4]uint64
+	for i := 0; i < 4; i++ {
+		bytes[i], _ = strconv.ParseUint(hexData[i*2:i*2+2], 16, 8)
+	}
+	return uint32(bytes[0]) | uint32(bytes[1])<<8 | uint32(bytes[2])<<16 | uint32(bytes[3])<<24
+}
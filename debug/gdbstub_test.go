@@ -0,0 +1,36 @@
+package debug
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func newTestSession(input string) *session {
+	return &session{r: bufio.NewReader(strings.NewReader(input))}
+}
+
+func TestReadPacketAcceptsValidChecksum(t *testing.T) {
+	s := newTestSession("$qSupported#37")
+	data, ok, err := s.readPacket()
+	if err != nil {
+		t.Fatalf("readPacket() error = %v", err)
+	}
+	if !ok {
+		t.Fatal("readPacket() ok = false, want true for a matching checksum")
+	}
+	if data != "qSupported" {
+		t.Errorf("readPacket() data = %q, want %q", data, "qSupported")
+	}
+}
+
+func TestReadPacketRejectsBadChecksum(t *testing.T) {
+	s := newTestSession("$qSupported#00")
+	_, ok, err := s.readPacket()
+	if err != nil {
+		t.Fatalf("readPacket() error = %v", err)
+	}
+	if ok {
+		t.Fatal("readPacket() ok = true, want false for a mismatched checksum")
+	}
+}
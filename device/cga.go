@@ -0,0 +1,24 @@
+package device
+
+// CGATextBufferSize はCGA互換テキストモード（80x25、1文字につき文字コードと
+// 属性の2バイト）のビデオメモリのバイト数。
+const CGATextBufferSize = 80 * 25 * 2
+
+// CGATextBuffer はCGA互換テキストモードのビデオメモリをエミュレートする。
+// 0xB8000からマップされる想定。
+type CGATextBuffer struct {
+	base  uint32
+	cells [CGATextBufferSize]uint8
+}
+
+func NewCGATextBuffer(base uint32) *CGATextBuffer {
+	return &CGATextBuffer{base: base}
+}
+
+func (c *CGATextBuffer) Read8(addr uint32) uint8 {
+	return c.cells[addr-c.base]
+}
+
+func (c *CGATextBuffer) Write8(addr uint32, value uint8) {
+	c.cells[addr-c.base] = value
+}
@@ -0,0 +1,20 @@
+package device
+
+// PIC は8259Aプログラマブル割込みコントローラの最小限のスタブ。
+// コマンド/マスクを保持するだけで、実際の割込み配送は行わない。
+type PIC struct {
+	mask uint8
+}
+
+func NewPIC() *PIC {
+	return &PIC{}
+}
+
+func (p *PIC) In8(port uint16) uint8 {
+	return p.mask
+}
+
+func (p *PIC) Out8(port uint16, value uint8) {
+	// ICW/OCWの区別はせず、最後に書かれた値をマスクとして保持するだけ。
+	p.mask = value
+}
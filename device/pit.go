@@ -0,0 +1,28 @@
+package device
+
+// PIT は8253/8254プログラマブルインターバルタイマの最小限のスタブ。
+// 0x40-0x42がチャンネル0-2のカウンタ、0x43がコマンドレジスタという
+// ポート配置だけを再現し、実際のカウントダウンは行わない。
+type PIT struct {
+	counters [3]uint8
+	command  uint8
+}
+
+func NewPIT() *PIT {
+	return &PIT{}
+}
+
+func (p *PIT) In8(port uint16) uint8 {
+	if port >= 0x40 && port <= 0x42 {
+		return p.counters[port-0x40]
+	}
+	return p.command
+}
+
+func (p *PIT) Out8(port uint16, value uint8) {
+	if port >= 0x40 && port <= 0x42 {
+		p.counters[port-0x40] = value
+		return
+	}
+	p.command = value
+}
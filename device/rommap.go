@@ -0,0 +1,47 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"otyaken/go-x86-emu/bus"
+)
+
+// romRegion は起動時に読み込むROM領域1つ分を表す。Addressは"0x..."形式の
+// 16進数文字列。
+type romRegion struct {
+	Address string `json:"address"`
+	File    string `json:"file"`
+}
+
+// LoadROMMap はpathのJSONファイルに列挙されたROM領域をbに読み込む。
+// JSONは次の形式の配列を想定する:
+//
+//	[{"address": "0xf0000", "file": "bios.bin"}, ...]
+func LoadROMMap(b *bus.Bus, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var regions []romRegion
+	if err := json.Unmarshal(data, &regions); err != nil {
+		return err
+	}
+
+	for _, r := range regions {
+		var address uint32
+		if _, err := fmt.Sscanf(r.Address, "0x%x", &address); err != nil {
+			return fmt.Errorf("rom map: invalid address %q: %w", r.Address, err)
+		}
+		rom, err := os.ReadFile(r.File)
+		if err != nil {
+			return err
+		}
+		if err := b.LoadROM(address, rom); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package device
+
+import "fmt"
+
+// UART16550 は16550 UARTの簡易モデル。レジスタの大半は実装しておらず、
+// 従来のIoIn8/IoOut8が0x03F8に対して行っていた、標準入出力を介した
+// 文字の送受信だけを再現する。
+type UART16550 struct{}
+
+func NewUART16550() *UART16550 {
+	return &UART16550{}
+}
+
+func (u *UART16550) In8(port uint16) uint8 {
+	var a uint32
+	fmt.Scan(&a)
+	return uint8(a)
+}
+
+func (u *UART16550) Out8(port uint16, value uint8) {
+	fmt.Printf("%c\n", value)
+}
@@ -0,0 +1,27 @@
+// Package disasm は emu パッケージのデコーダを使い、メモリイメージから
+// Intel構文の静的ディスアセンブリリストを生成する。
+package disasm
+
+import (
+	"fmt"
+	"strings"
+
+	"otyaken/go-x86-emu/emu"
+)
+
+// Listing はstart(含む)からend(含まない)までを1命令ずつデコードしたテキストを返す。
+// emu.DecodeInstructionは実行せずにデコードするだけなので、endが命令の
+// 途中を指していてもそこで打ち切る。
+func Listing(mem emu.Reader, start, end uint32) string {
+	var b strings.Builder
+	addr := start
+	for addr < end {
+		inst := emu.DecodeInstruction(mem, addr)
+		fmt.Fprintf(&b, "%08x: %s\n", addr, inst.String())
+		if inst.Length == 0 {
+			break
+		}
+		addr += inst.Length
+	}
+	return b.String()
+}
@@ -0,0 +1,215 @@
+package emu
+
+import "fmt"
+
+// Instruction は1命令分のデコード結果を表す。実行はせず、レジスタや
+// メモリを一切変更しない点がExecuteXxxとの違いで、disasmパッケージや
+// Runのトレース出力から使われる。
+type Instruction struct {
+	Address  uint32
+	Length   uint32
+	Mnemonic string
+	Operands string
+}
+
+func (i *Instruction) String() string {
+	if i.Operands == "" {
+		return i.Mnemonic
+	}
+	return i.Mnemonic + " " + i.Operands
+}
+
+// Reader はDecodeInstructionが必要とする最小限のメモリ読み取り能力。
+// *bus.Busはこれを満たすので、実行中のEmulatorからもdisasmパッケージの
+// 静的な読み取りからも同じデコードロジックを共有できる。
+type Reader interface {
+	Read8(addr uint32) uint8
+}
+
+var reg32Names = [...]string{"eax", "ecx", "edx", "ebx", "esp", "ebp", "esi", "edi"}
+var reg8Names = [...]string{"al", "cl", "dl", "bl", "ah", "ch", "dh", "bh"}
+
+// decodeModRM はmemのpos位置からModRM（及び付随するSIB/ディスプレースメント）
+// をデコードする。状態を変更しない純粋な関数で、Emulator.ParseModrmと
+// disasmパッケージの両方からこのロジックを共有する。
+// 戻り値の2つ目はModRMが消費したバイト数。
+func decodeModRM(mem Reader, pos uint32) (*ModRM, uint32) {
+	start := pos
+	modRM := &ModRM{}
+	code := mem.Read8(pos)
+	modRM.Mod = (code & 0xc0) >> 6
+	modRM.Reg = (code & 0x38) >> 3
+	modRM.Rm = code & 0x07
+	pos++
+
+	if modRM.Mod != 3 && modRM.Rm == 4 {
+		sib := mem.Read8(pos)
+		modRM.Sib = sib
+		modRM.Scale = (sib >> 6) & 0x03
+		modRM.Index = (sib >> 3) & 0x07
+		modRM.Base = sib & 0x07
+		pos++
+	}
+	if (modRM.Mod == 0 && modRM.Rm == 5) ||
+		(modRM.Mod == 0 && modRM.Rm == 4 && modRM.Base == 5) ||
+		modRM.Mod == 2 {
+		modRM.Disp32 = imm32At(mem, pos)
+		pos += 4
+	} else if modRM.Mod == 1 {
+		modRM.Disp8 = int8(mem.Read8(pos))
+		pos++
+	}
+	return modRM, pos - start
+}
+
+func imm32At(mem Reader, pos uint32) uint32 {
+	return uint32(mem.Read8(pos)) | uint32(mem.Read8(pos+1))<<8 |
+		uint32(mem.Read8(pos+2))<<16 | uint32(mem.Read8(pos+3))<<24
+}
+
+// rmText はModRMのrmオペランド（レジスタ、またはメモリの実効アドレス式）
+// をIntel構文の文字列にする。sizeは"8"か"32"。
+func rmText(m *ModRM, size string) string {
+	if m.Mod == 3 {
+		if size == "8" {
+			return reg8Names[m.Rm]
+		}
+		return reg32Names[m.Rm]
+	}
+	return "[" + memText(m) + "]"
+}
+
+func memText(m *ModRM) string {
+	if m.Mod == 0 && m.Rm == 5 {
+		return fmt.Sprintf("0x%x", m.Disp32)
+	}
+	base := reg32Names[m.Rm]
+	if m.Rm == 4 {
+		base = sibText(m)
+	}
+	switch m.Mod {
+	case 1:
+		return fmt.Sprintf("%s%+d", base, m.Disp8)
+	case 2:
+		return fmt.Sprintf("%s+0x%x", base, m.Disp32)
+	default:
+		return base
+	}
+}
+
+func sibText(m *ModRM) string {
+	var base string
+	if m.Base == 5 && m.Mod == 0 {
+		base = fmt.Sprintf("0x%x", m.Disp32)
+	} else {
+		base = reg32Names[m.Base]
+	}
+	if m.Index == 4 {
+		return base
+	}
+	return fmt.Sprintf("%s+%s*%d", base, reg32Names[m.Index], 1<<m.Scale)
+}
+
+// DecodeInstruction はmemのaddress位置にある1命令を、実行せずにデコードする。
+// EipやRegistersを変更しないため、ディスアセンブラや静的解析から
+// 安全に呼び出せる。
+func DecodeInstruction(mem Reader, address uint32) *Instruction {
+	code := mem.Read8(address)
+	switch code {
+	case 0x01:
+		m, n := decodeModRM(mem, address+1)
+		return &Instruction{address, 1 + n, "add", fmt.Sprintf("%s, %s", rmText(m, "32"), reg32Names[m.Reg])}
+
+	case 0x3B:
+		m, n := decodeModRM(mem, address+1)
+		return &Instruction{address, 1 + n, "cmp", fmt.Sprintf("%s, %s", reg32Names[m.Reg], rmText(m, "32"))}
+	case 0x3C:
+		return &Instruction{address, 2, "cmp", fmt.Sprintf("al, 0x%x", mem.Read8(address+1))}
+	case 0x3D:
+		return &Instruction{address, 5, "cmp", fmt.Sprintf("eax, 0x%x", imm32At(mem, address+1))}
+
+	case 0x68:
+		return &Instruction{address, 5, "push", fmt.Sprintf("0x%x", imm32At(mem, address+1))}
+	case 0x6A:
+		return &Instruction{address, 2, "push", fmt.Sprintf("0x%x", mem.Read8(address+1))}
+
+	case 0x70, 0x71, 0x72, 0x73, 0x74, 0x75, 0x78, 0x79, 0x7C, 0x7E:
+		mnemonics := map[uint8]string{
+			0x70: "jo", 0x71: "jno", 0x72: "jc", 0x73: "jnc",
+			0x74: "jz", 0x75: "jnz", 0x78: "js", 0x79: "jns",
+			0x7C: "jl", 0x7E: "jle",
+		}
+		diff := int8(mem.Read8(address + 1))
+		target := address + 2 + uint32(diff)
+		return &Instruction{address, 2, mnemonics[code], fmt.Sprintf("0x%x", target)}
+
+	case 0x83:
+		m, n := decodeModRM(mem, address+1)
+		mnemonics := map[uint8]string{0: "add", 5: "sub", 7: "cmp"}
+		mnemonic, ok := mnemonics[m.Reg]
+		if !ok {
+			mnemonic = "(bad)"
+		}
+		imm8 := mem.Read8(address + 1 + n)
+		return &Instruction{address, 1 + n + 1, mnemonic, fmt.Sprintf("%s, 0x%x", rmText(m, "32"), imm8)}
+
+	case 0x88:
+		m, n := decodeModRM(mem, address+1)
+		return &Instruction{address, 1 + n, "mov", fmt.Sprintf("%s, %s", rmText(m, "8"), reg8Names[m.Reg])}
+	case 0x89:
+		m, n := decodeModRM(mem, address+1)
+		return &Instruction{address, 1 + n, "mov", fmt.Sprintf("%s, %s", rmText(m, "32"), reg32Names[m.Reg])}
+	case 0x8A:
+		m, n := decodeModRM(mem, address+1)
+		return &Instruction{address, 1 + n, "mov", fmt.Sprintf("%s, %s", reg8Names[m.Reg], rmText(m, "8"))}
+	case 0x8B:
+		m, n := decodeModRM(mem, address+1)
+		return &Instruction{address, 1 + n, "mov", fmt.Sprintf("%s, %s", reg32Names[m.Reg], rmText(m, "32"))}
+
+	case 0xC3:
+		return &Instruction{address, 1, "ret", ""}
+	case 0xC7:
+		m, n := decodeModRM(mem, address+1)
+		imm32 := imm32At(mem, address+1+n)
+		return &Instruction{address, 1 + n + 4, "mov", fmt.Sprintf("%s, 0x%x", rmText(m, "32"), imm32)}
+	case 0xC9:
+		return &Instruction{address, 1, "leave", ""}
+
+	case 0xCD:
+		return &Instruction{address, 2, "int", fmt.Sprintf("0x%x", mem.Read8(address+1))}
+
+	case 0xE8:
+		diff := int32(imm32At(mem, address+1))
+		return &Instruction{address, 5, "call", fmt.Sprintf("0x%x", address+5+uint32(diff))}
+	case 0xE9:
+		diff := int32(imm32At(mem, address+1))
+		return &Instruction{address, 5, "jmp", fmt.Sprintf("0x%x", address+5+uint32(diff))}
+	case 0xEB:
+		diff := int8(mem.Read8(address + 1))
+		return &Instruction{address, 2, "jmp", fmt.Sprintf("0x%x", address+2+uint32(diff))}
+	case 0xEE:
+		return &Instruction{address, 1, "out", "dx, al"}
+
+	case 0xFF:
+		m, n := decodeModRM(mem, address+1)
+		if m.Reg == 0 {
+			return &Instruction{address, 1 + n, "inc", rmText(m, "32")}
+		}
+		return &Instruction{address, 1 + n, "(bad)", ""}
+	}
+
+	switch {
+	case code >= 0x40 && code <= 0x47:
+		return &Instruction{address, 1, "inc", reg32Names[code-0x40]}
+	case code >= 0x50 && code <= 0x57:
+		return &Instruction{address, 1, "push", reg32Names[code-0x50]}
+	case code >= 0x58 && code <= 0x5F:
+		return &Instruction{address, 1, "pop", reg32Names[code-0x58]}
+	case code >= 0xB0 && code <= 0xB7:
+		return &Instruction{address, 2, "mov", fmt.Sprintf("%s, 0x%x", reg8Names[code-0xB0], mem.Read8(address+1))}
+	case code >= 0xB8 && code <= 0xBF:
+		return &Instruction{address, 5, "mov", fmt.Sprintf("%s, 0x%x", reg32Names[code-0xB8], imm32At(mem, address+1))}
+	}
+
+	return &Instruction{address, 1, "(bad)", fmt.Sprintf("0x%02x", code)}
+}
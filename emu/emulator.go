@@ -0,0 +1,1066 @@
+package emu
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"otyaken/go-x86-emu/bus"
+	"otyaken/go-x86-emu/device"
+)
+
+// レジスタ番号
+const (
+	CEax = iota
+	CEcx
+	CEdx
+	CEbx
+	CEsp
+	CEbp
+	CEsi
+	CEdi
+	RegistersCount
+)
+
+const (
+	CAl = CEax
+	CAh = CEax + 4
+	CCl = CEcx
+	CCh = CEcx + 4
+	CDl = CEdx
+	CDh = CEdx + 4
+	CBl = CEbx
+	CBh = CEbx + 4
+)
+
+// eflags関連
+const (
+	CarryFlag    = uint32(1)
+	ZeroFlag     = uint32(1 << 6)
+	SignFlag     = uint32(1 << 7)
+	OverFlowFlag = uint32(1 << 11)
+)
+
+type Emulator struct {
+	// 汎用レジスタ
+	Registers [RegistersCount]uint32
+	// eflagsレジスタ
+	Eflags uint32
+	// メモリ/I/Oポート空間。デバイスはbus.MapMem/MapPortで登録する。
+	Bus *bus.Bus
+	// EIPレジスタ
+	Eip uint32
+	// 最大メモリ
+	MaxMemorySize uint32
+	// 実行した命令の消費サイクル数の累計。
+	Cycles uint64
+	// ソフトウェアブレークポイントが設定されたアドレスの集合。
+	breakpoints map[uint32]struct{}
+
+	// 以下はjit.goのスレッデッドコードキャッシュが使う状態。
+
+	// jitEnabledはRunJITでのみtrueになる。falseのままならRunCyclesは
+	// 従来通り1命令ずつインタプリタで実行する。
+	jitEnabled bool
+	// EIPをキーにした翻訳済み基本ブロックのキャッシュ。
+	blockCache map[uint32]*Block
+	// EIPごとにそのアドレスに到達した回数。jitThreshold回に達すると翻訳してキャッシュする。
+	entryCounts map[uint32]uint32
+	// ページ番号から、そのページに跨る基本ブロックの開始アドレス一覧への逆引き。
+	// 自己書き換えコードによる書き込み時のキャッシュ無効化に使う。
+	blockPages map[uint32][]uint32
+
+	// 実行した命令数の累計。DumpEmulatorのMIPS算出に使う。
+	instrCount uint64
+	// Run/RunJITを開始した時刻。
+	startTime time.Time
+	// 最初の基本ブロックがキャッシュされた（＝JITが実際に働き始めた）かどうか。
+	jitEngaged         bool
+	jitStartTime       time.Time
+	jitStartInstrCount uint64
+}
+
+// SetBreakpoint はaddressにソフトウェアブレークポイントを設定する。
+// RunCycles（及びそれを使うRun/RunJITやGDBスタブの'c'パケット）はそのアドレスをディスパッチする
+// 直前で停止するようになる。
+func (e *Emulator) SetBreakpoint(address uint32) {
+	if e.breakpoints == nil {
+		e.breakpoints = make(map[uint32]struct{})
+	}
+	e.breakpoints[address] = struct{}{}
+}
+
+// ClearBreakpoint はaddressに設定されたソフトウェアブレークポイントを外す。
+func (e *Emulator) ClearBreakpoint(address uint32) {
+	delete(e.breakpoints, address)
+}
+
+func (e *Emulator) hasBreakpoint(address uint32) bool {
+	_, ok := e.breakpoints[address]
+	return ok
+}
+
+func (e *Emulator) addCycles(n uint64) {
+	e.Cycles += n
+}
+
+// checkPageCross は size バイトのメモリアクセスがページ境界（4KiB）を
+// またぐ場合に1サイクルのペナルティを加算する。
+func (e *Emulator) checkPageCross(address uint32, size uint32) {
+	const pageSize = 0x1000
+	if address/pageSize != (address+size-1)/pageSize {
+		e.addCycles(1)
+	}
+}
+
+func (e *Emulator) DumpEmulator() {
+	fmt.Printf("EAX = 0x%08x\n", e.Registers[CEax])
+	fmt.Printf("ECX = 0x%08x\n", e.Registers[CEcx])
+	fmt.Printf("EDX = 0x%08x\n", e.Registers[CEdx])
+	fmt.Printf("EBX = 0x%08x\n", e.Registers[CEbx])
+	fmt.Printf("ESP = 0x%08x\n", e.Registers[CEsp])
+	fmt.Printf("EBP = 0x%08x\n", e.Registers[CEbp])
+	fmt.Printf("ESI = 0x%08x\n", e.Registers[CEsi])
+	fmt.Printf("EDI = 0x%08x\n", e.Registers[CEdi])
+	fmt.Printf("EIP = 0x%08x\n", e.Eip)
+	e.dumpMIPS()
+}
+
+// dumpMIPS はインタプリタのみの区間とJITブロックキャッシュが働いた区間の
+// MIPS（百万命令毎秒）を分けて表示する。jit.goの複雑さに見合う効果が
+// 出ているかを確認するためのもの。JITが一度も働かなかった場合は
+// 区間を分けずに1つだけ表示する。
+func (e *Emulator) dumpMIPS() {
+	if !e.jitEngaged {
+		fmt.Printf("MIPS: %s\n", formatMIPS(e.instrCount, time.Since(e.startTime)))
+		return
+	}
+	fmt.Printf("MIPS before JIT: %s\n", formatMIPS(e.jitStartInstrCount, e.jitStartTime.Sub(e.startTime)))
+	fmt.Printf("MIPS after JIT:  %s\n", formatMIPS(e.instrCount-e.jitStartInstrCount, time.Since(e.jitStartTime)))
+}
+
+func formatMIPS(instrCount uint64, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.3f", float64(instrCount)/elapsed.Seconds()/1e6)
+}
+
+// ModRM はModRMバイトと、それに続くSIBバイト・ディスプレースメントを保持する。
+type ModRM struct {
+	Mod uint8
+	// Regはレジスタ番号を表すが、一部の命令ではオペコード拡張として使われる。
+	Reg uint8
+	Rm  uint8
+
+	// SIBバイトが存在する場合（Mod != 3 && Rm == 4）のみ使用する。
+	Sib   uint8
+	Scale uint8
+	Index uint8
+	Base  uint8
+
+	Disp8  int8
+	Disp32 uint32
+}
+
+// ParseModrmはEipの指すModRM（及び付随するSIB/ディスプレースメント）を
+// 読み取り、その分だけEipを進める。デコード自体の中身はdecodeModRMに
+// 切り出してあり、disasmパッケージの非破壊的なデコードと共有している。
+func (e *Emulator) ParseModrm() *ModRM {
+	modRM, length := decodeModRM(e.Bus, e.Eip)
+	e.Eip += length
+	return modRM
+}
+
+func (e *Emulator) GetCode8(index uint32) uint32 {
+	return uint32(e.Bus.Read8(e.Eip + index))
+}
+
+func (e *Emulator) GetSignCode8(index uint32) int32 {
+	val := e.Bus.Read8(e.Eip + index)
+	sign := val >> 7
+	// 符号が正の時、そのままint32に変換しリターン。
+	if sign == 0 {
+		return int32(val)
+	}
+	// 負の数をuint8の値から計算。
+	// 符号が負の時、2の補数をとりint32に変換することにより、負の値の大きさを取得。
+	// その後マイナスを掛け、リターン。
+	return -(int32((^val + 1)))
+}
+
+func (e *Emulator) GetSignCode32(index uint32) int32 {
+
+	val := e.GetCode32(index)
+
+	sign := val >> 31
+	// 符号が正の時、そのままint32に変換しリターン。
+	if sign == 0 {
+		return int32(val)
+	}
+	// 負の数をuint8の値から計算。
+	// 符号が負の時、2の補数をとりint32に変換することにより、負の値の大きさを取得。
+	// その後マイナスを掛け、リターン。
+	return -(int32((^val + 1)))
+}
+
+func (e *Emulator) GetCode32(index uint32) uint32 {
+	var (
+		ret uint32
+		i   uint32
+	)
+
+	for i = 0; i < 4; i++ {
+		ret |= e.GetCode8(index+i) << (i * 8)
+	}
+	return ret
+}
+
+func (e *Emulator) MovR32Imm32() {
+	reg := e.GetCode8(0) - 0xB8
+	value := e.GetCode32(1)
+	e.Registers[reg] = uint32(value)
+	e.Eip += 5
+}
+
+func (e *Emulator) ShortJump() {
+	diff := e.GetSignCode8(1)
+	if diff > 0 {
+		e.Eip += uint32(diff) + 2
+	} else {
+		e.Eip -= uint32(-diff)
+		e.Eip += 2
+	}
+}
+
+func (e *Emulator) NearJump() {
+	diff := e.GetSignCode32(1)
+	if diff > 0 {
+		e.Eip += uint32(diff) + 5
+	} else {
+		e.Eip -= uint32(-diff)
+		e.Eip += 5
+	}
+}
+
+// movRm32Imm32Coreはjit.goのブロックキャッシュと共有する実行本体。
+func (e *Emulator) movRm32Imm32Core(m *ModRM, value uint32) {
+	e.setRm32(m, value)
+}
+
+func (e *Emulator) MovRm32Imm32() {
+	e.Eip += 1
+	modRM := e.ParseModrm()
+	value := e.GetCode32(0)
+	e.Eip += 4
+	e.movRm32Imm32Core(modRM, value)
+}
+
+func (e *Emulator) setRegister32(index uint8, value uint32) {
+	e.Registers[index] = value
+}
+
+func (e *Emulator) getRegister32(index uint8) uint32 {
+	return e.Registers[index]
+}
+
+func (e *Emulator) calcMemoryAddress(m *ModRM) uint32 {
+	if m.Mod == 0 {
+		if m.Rm == 4 {
+			return e.calcSibAddress(m)
+		} else if m.Rm == 5 {
+			return m.Disp32
+		} else {
+			return e.getRegister32(m.Rm)
+		}
+	} else if m.Mod == 1 {
+		if m.Rm == 4 {
+			return addDisp8(e.calcSibAddress(m), m.Disp8)
+		} else {
+			return addDisp8(e.getRegister32(m.Rm), m.Disp8)
+		}
+	} else if m.Mod == 2 {
+		if m.Rm == 4 {
+			return e.calcSibAddress(m) + m.Disp32
+		} else {
+			return e.getRegister32(m.Rm) + m.Disp32
+		}
+	} else {
+		fmt.Printf("Not implemented ModRM rm = 3\n")
+		os.Exit(0)
+	}
+	// エラー。設計について再検討する必要あり。
+	return 0
+}
+
+// calcSibAddress はSIBバイトのscale/index/baseからベースアドレスを計算する。
+// base = 5 かつ mod = 0 の場合はベースレジスタを使わずdisp32のみを使う。
+// index = 4 の場合はインデックスレジスタを使わない。
+func (e *Emulator) calcSibAddress(m *ModRM) uint32 {
+	var address uint32
+	if m.Base == 5 && m.Mod == 0 {
+		address = m.Disp32
+	} else {
+		address = e.getRegister32(m.Base)
+	}
+	if m.Index != 4 {
+		address += e.getRegister32(m.Index) << m.Scale
+	}
+	return address
+}
+
+func addDisp8(base uint32, disp8 int8) uint32 {
+	if disp8 > 0 {
+		return base + uint32(disp8)
+	}
+	return base - uint32(-disp8)
+}
+
+func (e *Emulator) setMemory8(address uint32, value uint32) {
+	e.Bus.Write8(address, uint8(value&0xFF))
+	// 自己書き換えコード対策: このアドレスを跨ぐ翻訳済みブロックが
+	// あれば無効化する（jit.go）。
+	if e.jitEnabled {
+		e.invalidateBlocksCovering(address)
+	}
+}
+
+func (e *Emulator) getMemory8(address uint32) uint8 {
+	return e.Bus.Read8(address)
+}
+
+// WriteMemory8はBusへの1バイト書き込みを行う。setMemory8と同じく自己
+// 書き換えコードのJITブロック無効化を伴うため、GDBリモートシリアル
+// プロトコルの'M'パケットなど、デコード経路を介さずメモリを直接書き
+// 換える呼び出し元はe.Bus.Write8ではなくこちらを使うこと。
+func (e *Emulator) WriteMemory8(address uint32, value uint8) {
+	e.setMemory8(address, uint32(value))
+}
+
+func (e *Emulator) setMemory32(address uint32, value uint32) {
+	e.checkPageCross(address, 4)
+	var i uint32
+	for i = 0; i < 4; i++ {
+		e.setMemory8(address+i, (value>>(i*8))&0xFF)
+	}
+}
+
+func (e *Emulator) getMemory32(address uint32) uint32 {
+	e.checkPageCross(address, 4)
+	var (
+		i   uint32
+		ret uint32
+	)
+
+	for i = 0; i < 4; i++ {
+		ret |= uint32(e.getMemory8(address+i)) << (i * 8)
+	}
+	return ret
+}
+
+// movRm32R32Coreはjit.goのブロックキャッシュと共有する実行本体。
+func (e *Emulator) movRm32R32Core(m *ModRM) {
+	e.setRm32(m, e.getR32(m))
+}
+
+func (e *Emulator) MovRm32R32() {
+	e.Eip += 1
+	modRM := e.ParseModrm()
+	e.movRm32R32Core(modRM)
+}
+
+// movR32Rm32Coreはjit.goのブロックキャッシュと共有する実行本体。
+func (e *Emulator) movR32Rm32Core(m *ModRM) {
+	e.setR32(m, e.getRm32(m))
+}
+
+func (e *Emulator) MovR32Rm32() {
+	e.Eip += 1
+	modRM := e.ParseModrm()
+	e.movR32Rm32Core(modRM)
+}
+
+// addRm32R32Coreは事前にデコード済みのModRMを受け取って実行するだけの部分で、
+// AddRm32R32本体とjit.goのブロックキャッシュの両方から呼ばれる。
+func (e *Emulator) addRm32R32Core(m *ModRM) {
+	r32 := e.getR32(m)
+	rm32 := e.getRm32(m)
+	e.setRm32(m, r32+rm32)
+}
+
+func (e *Emulator) AddRm32R32() {
+	e.Eip += 1
+	modRM := e.ParseModrm()
+	e.addRm32R32Core(modRM)
+}
+
+func (e *Emulator) AddRm32Imm8(m *ModRM) {
+	rm32 := e.getRm32(m)
+	imm8 := e.GetSignCode8(0)
+	e.Eip += 1
+	e.setRm32(m, rm32+uint32(imm8))
+}
+
+// code83Table は0x83命令のReg拡張（サブオペコード）ごとのハンドラ。
+var code83Table = [8]func(*Emulator, *ModRM){
+	0: (*Emulator).AddRm32Imm8,
+	5: (*Emulator).SubRm32Imm8,
+	7: (*Emulator).CmpRm32Imm8,
+}
+
+func (e *Emulator) Code83() {
+	e.Eip += 1
+	modRM := e.ParseModrm()
+	//modRM.Regはopecodeも表す。
+	handler := code83Table[modRM.Reg]
+	if handler == nil {
+		fmt.Printf("Not implemented: 83 %d\n", modRM.Reg)
+		os.Exit(1)
+	}
+	handler(e, modRM)
+}
+
+func (e *Emulator) IncRm32(m *ModRM) {
+	value := e.getRm32(m)
+	e.setRm32(m, value+1)
+}
+
+// codeFFTable は0xFF命令のReg拡張（サブオペコード）ごとのハンドラ。
+var codeFFTable = [8]func(*Emulator, *ModRM){
+	0: (*Emulator).IncRm32,
+}
+
+func (e *Emulator) CodeFF() {
+	e.Eip += 1
+	modRM := e.ParseModrm()
+	//modRM.Regはopecodeも表す。
+	handler := codeFFTable[modRM.Reg]
+	if handler == nil {
+		fmt.Printf("Not implemented: FF %d\n", modRM.Reg)
+		os.Exit(1)
+	}
+	handler(e, modRM)
+}
+
+// code0FTable は0x0Fに続く2バイト目オペコードごとのハンドラ。
+// 現時点で実装済みの2バイト命令はないため、常にnilで未実装扱いになる。
+var code0FTable [256]func(*Emulator)
+
+func (e *Emulator) Code0F() {
+	e.Eip += 1
+	subOpCode := e.GetCode8(0)
+	handler := code0FTable[subOpCode]
+	if handler == nil {
+		fmt.Printf("Not implemented: 0F %02x\n", subOpCode)
+		os.Exit(1)
+	}
+	handler(e)
+}
+
+func (e *Emulator) PushR32() {
+	reg := e.GetCode8(0) - 0x50
+	e.push32(e.getRegister32(uint8(reg)))
+	e.Eip += 1
+}
+
+func (e *Emulator) push32(value uint32) {
+	address := e.getRegister32(CEsp) - 0x4
+	e.setRegister32(CEsp, address)
+	e.setMemory32(address, value)
+}
+
+func (e *Emulator) getR32(m *ModRM) uint32 {
+	return e.getRegister32(m.Reg)
+}
+
+func (e *Emulator) popR32() {
+	reg := e.GetCode8(0) - 0x58
+	e.setRegister32(uint8(reg), e.pop32())
+	e.Eip += 1
+}
+
+func (e *Emulator) pop32() uint32 {
+	address := e.getRegister32(CEsp)
+	ret := e.getMemory32(address)
+	e.setRegister32(CEsp, address+0x4)
+	return ret
+}
+
+func (e *Emulator) CallRel32() {
+	diff := e.GetSignCode32(1)
+	e.push32(e.Eip + 5)
+	if diff > 0 {
+		e.Eip += uint32(diff) + 5
+	} else {
+		e.Eip -= uint32(-diff)
+		e.Eip += 5
+	}
+}
+
+func (e *Emulator) Ret() {
+	e.Eip = e.pop32()
+}
+
+func (e *Emulator) Leave() {
+	ebp := e.getRegister32(CEbp)
+	e.setRegister32(CEsp, ebp)
+	e.setRegister32(CEbp, e.pop32())
+	e.Eip += 1
+}
+
+func (e *Emulator) PushImm32() {
+	value := e.GetCode32(1)
+	e.push32(value)
+	e.Eip += 5
+}
+
+func (e *Emulator) PushImm8() {
+	value := e.GetCode8(1)
+	e.push32(value)
+	e.Eip += 2
+}
+
+func (e *Emulator) setR32(m *ModRM, value uint32) {
+	e.setRegister32(m.Reg, value)
+}
+
+func (e *Emulator) getRm32(m *ModRM) uint32 {
+	if m.Mod == 3 {
+		return e.getRegister32(m.Rm)
+	}
+	address := e.calcMemoryAddress(m)
+	return e.getMemory32(address)
+}
+
+func (e *Emulator) setRm32(m *ModRM, value uint32) {
+	if m.Mod == 3 {
+		e.setRegister32(m.Rm, value)
+	} else {
+		address := e.calcMemoryAddress(m)
+		e.setMemory32(address, value)
+	}
+}
+
+// cmpR32Rm32Coreはjit.goのブロックキャッシュと共有する実行本体。
+func (e *Emulator) cmpR32Rm32Core(m *ModRM) {
+	r32 := e.getR32(m)
+	rm32 := e.getRm32(m)
+	result := uint64(r32) - uint64(rm32)
+	e.updateEflagsSub(r32, rm32, result)
+}
+
+func (e *Emulator) CmpR32Rm32() {
+	e.Eip += 1
+	modRM := e.ParseModrm()
+	e.cmpR32Rm32Core(modRM)
+}
+
+func (e *Emulator) CmpRm32Imm8(m *ModRM) {
+	rm32 := e.getRm32(m)
+	imm8 := uint32(e.GetSignCode8(0))
+	e.Eip += 1
+	result := uint64(rm32) - uint64(imm8)
+	e.updateEflagsSub(rm32, imm8, result)
+}
+
+func (e *Emulator) SubRm32Imm8(m *ModRM) {
+	rm32 := e.getRm32(m)
+	imm8 := e.GetSignCode8(0)
+	e.Eip += 1
+	result := uint64(rm32) - uint64(imm8)
+	e.setRm32(m, uint32(result))
+	e.updateEflagsSub(rm32, uint32(imm8), result)
+}
+
+func (e *Emulator) updateEflagsSub(v1 uint32, v2 uint32, result uint64) {
+	sign1 := v1 >> 31
+	sign2 := v2 >> 31
+	signr := (result >> 31) & 0x01
+
+	e.setCarry((result >> 32) != 0)
+	e.setZero(result == 0)
+	e.setSign(signr == 1)
+	e.setOverFlow(sign1 != sign2 && sign1 != uint32(signr))
+}
+
+func (e *Emulator) setCarry(b bool) {
+	if b {
+		e.Eflags |= CarryFlag
+	} else {
+		e.Eflags &= ^CarryFlag
+	}
+}
+
+func (e *Emulator) setZero(b bool) {
+	if b {
+		e.Eflags |= ZeroFlag
+	} else {
+		e.Eflags &= ^ZeroFlag
+	}
+}
+
+func (e *Emulator) setSign(b bool) {
+	if b {
+		e.Eflags |= SignFlag
+	} else {
+		e.Eflags &= ^SignFlag
+	}
+}
+
+func (e *Emulator) setOverFlow(b bool) {
+	if b {
+		e.Eflags |= OverFlowFlag
+	} else {
+		e.Eflags &= ^OverFlowFlag
+	}
+}
+
+func (e *Emulator) isCarry() bool {
+	return e.Eflags&CarryFlag != 0
+}
+
+func (e *Emulator) isZero() bool {
+	return e.Eflags&ZeroFlag != 0
+}
+
+func (e *Emulator) isSign() bool {
+	return e.Eflags&SignFlag != 0
+}
+
+func (e *Emulator) isOverFlow() bool {
+	return e.Eflags&OverFlowFlag != 0
+}
+
+// jumpIf は条件付き近接ジャンプの共通処理。taken が真の場合のみ
+// 符号付き8ビットオフセット分Eipを進め、分岐成立ペナルティとして
+// 1サイクル加算する。
+func (e *Emulator) jumpIf(taken bool) {
+	var diff int32
+	if taken {
+		diff = e.GetSignCode8(1)
+		e.addCycles(1)
+	} else {
+		diff = 0
+	}
+
+	if diff > 0 {
+		e.Eip += uint32(diff) + 2
+	} else {
+		e.Eip -= uint32(-diff)
+		e.Eip += 2
+	}
+}
+
+func (e *Emulator) Js() {
+	e.jumpIf(e.isSign())
+}
+
+func (e *Emulator) Jns() {
+	e.jumpIf(!e.isSign())
+}
+
+func (e *Emulator) Jc() {
+	e.jumpIf(e.isCarry())
+}
+
+func (e *Emulator) Jnc() {
+	e.jumpIf(!e.isCarry())
+}
+
+func (e *Emulator) Jz() {
+	e.jumpIf(e.isZero())
+}
+
+func (e *Emulator) Jnz() {
+	e.jumpIf(!e.isZero())
+}
+
+func (e *Emulator) Jo() {
+	e.jumpIf(e.isOverFlow())
+}
+
+func (e *Emulator) Jno() {
+	e.jumpIf(!e.isOverFlow())
+}
+
+func (e *Emulator) Jl() {
+	e.jumpIf(e.isSign() != e.isOverFlow())
+}
+
+func (e *Emulator) Jle() {
+	e.jumpIf(e.isZero() || e.isSign() != e.isOverFlow())
+}
+
+func (e *Emulator) InAlDx() {
+	address := e.getRegister32(CEdx) & 0xFFFF
+	value := e.IoIn8(uint16(address))
+	e.setRegister8(CAl, value)
+	e.Eip += 1
+}
+
+func (e *Emulator) OutDxAl() {
+	address := e.getRegister32(CEdx) & 0xFFFF
+	value := e.getRegister8(CAl)
+	e.IoOut8(uint16(address), value)
+	e.Eip += 1
+}
+
+func (e *Emulator) IoIn8(address uint16) uint8 {
+	return e.Bus.In8(address)
+}
+
+func (e *Emulator) IoOut8(address uint16, value uint8) {
+	e.Bus.Out8(address, value)
+}
+
+func (e *Emulator) getRegister8(index uint8) uint8 {
+	if index < 4 {
+		return uint8(e.Registers[index] & 0xFF)
+	} else {
+		//Highを返すので8ビット右シフト
+		return uint8((e.Registers[index-4] >> 8) & 0xFF)
+	}
+}
+
+func (e *Emulator) setRegister8(index uint8, value uint8) {
+	if index < 4 {
+		v := e.Registers[index] & 0xFFFFFF00
+		e.Registers[index] = v | uint32(value)
+	} else {
+		v := e.Registers[index-4] & 0xFFFF00FF
+		e.Registers[index-4] = v | (uint32(value) << 8)
+	}
+}
+
+func (e *Emulator) MovR8Imm8() {
+	reg := e.GetCode8(0) - 0xB0
+	e.setRegister8(uint8(reg), uint8(e.GetCode8(1)))
+	e.Eip += 2
+}
+
+func (e *Emulator) getRm8(m *ModRM) uint8 {
+	if m.Mod == 3 {
+		return e.getRegister8(m.Rm)
+	} else {
+		address := e.calcMemoryAddress(m)
+		return e.getMemory8(address)
+	}
+}
+
+func (e *Emulator) setRm8(m *ModRM, value uint8) {
+	if m.Mod == 3 {
+		e.setRegister8(m.Rm, value)
+	} else {
+		address := e.calcMemoryAddress(m)
+		e.setMemory8(address, uint32(value))
+	}
+}
+
+func (e *Emulator) setR8(m *ModRM, value uint8) {
+	e.setRegister8(m.Reg, value)
+}
+
+func (e *Emulator) getR8(m *ModRM) uint8 {
+	return e.getRegister8(m.Reg)
+}
+
+// movRm8R8Coreはjit.goのブロックキャッシュと共有する実行本体。
+func (e *Emulator) movRm8R8Core(m *ModRM) {
+	e.setRm8(m, e.getR8(m))
+}
+
+func (e *Emulator) MovRm8R8() {
+	e.Eip += 1
+	modRM := e.ParseModrm()
+	e.movRm8R8Core(modRM)
+}
+
+// movR8Rm8Coreはjit.goのブロックキャッシュと共有する実行本体。
+func (e *Emulator) movR8Rm8Core(m *ModRM) {
+	e.setR8(m, e.getRm8(m))
+}
+
+func (e *Emulator) MovR8Rm8() {
+	e.Eip += 1
+	modRM := e.ParseModrm()
+	e.movR8Rm8Core(modRM)
+}
+
+func (e *Emulator) CmpAlImm8() {
+	value := e.GetCode8(1)
+	al := e.getRegister8(CAl)
+	var result uint64
+	result = uint64(al) - uint64(value)
+	e.updateEflagsSub(uint32(al), value, result)
+	e.Eip += 2
+}
+
+func (e *Emulator) CmpEaxImm32() {
+	value := e.GetCode32(1)
+	eax := e.getRegister32(CEax)
+	var result uint64
+	result = uint64(eax) - uint64(value)
+	e.updateEflagsSub(eax, value, result)
+	e.Eip += 5
+}
+
+func (e *Emulator) IncR32() {
+	reg := e.GetCode8(0) - 0x40
+	e.setRegister32(uint8(reg), e.getRegister32(uint8(reg))+1)
+	e.Eip += 1
+}
+
+// ソフトウェア割込み
+func (e *Emulator) Swi() {
+	intIndex := e.GetCode8(1)
+	e.Eip += 2
+
+	switch intIndex {
+	case 0x10:
+		e.biosVideo()
+	default:
+		fmt.Printf("Unknown interrupt: 0x%02x\n", intIndex)
+	}
+}
+
+func (e *Emulator) biosVideo() {
+	funcIndex := e.getRegister8(CAh)
+	switch funcIndex {
+	case 0x0e:
+		e.biosVideoTeletype()
+	default:
+		fmt.Printf("Not implemented BIOS video function: 0x%02x\n", funcIndex)
+	}
+}
+
+// alレジスタに格納された文字コードをblレジスタに格納された文字色で画面に描画
+func (e *Emulator) biosVideoTeletype() {
+	biosToTerminal := [...]int{30, 34, 32, 36, 31, 35, 33, 37}
+	color := e.getRegister8(CBl) & 0x0F
+	char := e.getRegister8(CAl)
+	terminalColor := biosToTerminal[color&0x07]
+	bright := (color & 0x08) >> 3
+	str := fmt.Sprintf("\x1b[%d;%dm%c\x1b[0m]", bright, terminalColor, char)
+	e.putString(str)
+}
+
+func (e *Emulator) putString(s string) {
+	for i := 0; i < len(s); i++ {
+		e.IoOut8(0x03F8, s[i])
+	}
+}
+
+// opcodeEntry は1バイトオペコードに対するハンドラと、その基本サイクル数
+// （386クラスのCPUのドキュメント値を参考にした概算）を保持する。
+// 分岐成立時やページ境界をまたぐメモリアクセスの追加ペナルティは、
+// 各ハンドラ側でaddCycles/checkPageCrossを通じて別途加算される。
+type opcodeEntry struct {
+	handler func(*Emulator)
+	cycles  uint64
+}
+
+// opcodeTable は1バイトオペコードから実行ハンドラを引くディスパッチテーブル。
+var opcodeTable [256]opcodeEntry
+
+func init() {
+	opcodeTable[0x01] = opcodeEntry{(*Emulator).AddRm32R32, 2}
+
+	opcodeTable[0x3B] = opcodeEntry{(*Emulator).CmpR32Rm32, 2}
+	opcodeTable[0x3C] = opcodeEntry{(*Emulator).CmpAlImm8, 2}
+	opcodeTable[0x3D] = opcodeEntry{(*Emulator).CmpEaxImm32, 2}
+
+	for i := uint32(0); i < 8; i++ {
+		opcodeTable[0x40+i] = opcodeEntry{(*Emulator).IncR32, 2}
+		opcodeTable[0x50+i] = opcodeEntry{(*Emulator).PushR32, 2}
+		opcodeTable[0x58+i] = opcodeEntry{(*Emulator).popR32, 4}
+		opcodeTable[0xB0+i] = opcodeEntry{(*Emulator).MovR8Imm8, 2}
+		opcodeTable[0xB8+i] = opcodeEntry{(*Emulator).MovR32Imm32, 2}
+	}
+
+	opcodeTable[0x68] = opcodeEntry{(*Emulator).PushImm32, 2}
+	opcodeTable[0x6A] = opcodeEntry{(*Emulator).PushImm8, 2}
+	opcodeTable[0x70] = opcodeEntry{(*Emulator).Jo, 3}
+	opcodeTable[0x71] = opcodeEntry{(*Emulator).Jno, 3}
+	opcodeTable[0x72] = opcodeEntry{(*Emulator).Jc, 3}
+	opcodeTable[0x73] = opcodeEntry{(*Emulator).Jnc, 3}
+	opcodeTable[0x74] = opcodeEntry{(*Emulator).Jz, 3}
+	opcodeTable[0x75] = opcodeEntry{(*Emulator).Jnz, 3}
+	opcodeTable[0x78] = opcodeEntry{(*Emulator).Js, 3}
+	opcodeTable[0x79] = opcodeEntry{(*Emulator).Jns, 3}
+	opcodeTable[0x7C] = opcodeEntry{(*Emulator).Jl, 3}
+	opcodeTable[0x7E] = opcodeEntry{(*Emulator).Jle, 3}
+
+	opcodeTable[0x0F] = opcodeEntry{(*Emulator).Code0F, 0}
+	opcodeTable[0x83] = opcodeEntry{(*Emulator).Code83, 2}
+	opcodeTable[0x88] = opcodeEntry{(*Emulator).MovRm8R8, 2}
+	opcodeTable[0x89] = opcodeEntry{(*Emulator).MovRm32R32, 2}
+	opcodeTable[0x8A] = opcodeEntry{(*Emulator).MovR8Rm8, 2}
+	opcodeTable[0x8B] = opcodeEntry{(*Emulator).MovR32Rm32, 2}
+
+	opcodeTable[0xC3] = opcodeEntry{(*Emulator).Ret, 5}
+	opcodeTable[0xC7] = opcodeEntry{(*Emulator).MovRm32Imm32, 2}
+	opcodeTable[0xC9] = opcodeEntry{(*Emulator).Leave, 2}
+
+	opcodeTable[0xCD] = opcodeEntry{(*Emulator).Swi, 26}
+
+	opcodeTable[0xE8] = opcodeEntry{(*Emulator).CallRel32, 3}
+	opcodeTable[0xE9] = opcodeEntry{(*Emulator).NearJump, 3}
+	opcodeTable[0xEB] = opcodeEntry{(*Emulator).ShortJump, 3}
+	opcodeTable[0xEE] = opcodeEntry{(*Emulator).OutDxAl, 10}
+	opcodeTable[0xFF] = opcodeEntry{(*Emulator).CodeFF, 2}
+}
+
+func (e *Emulator) executeOpCode(opCode uint32) {
+	entry := opcodeTable[opCode]
+	// 実装されていない命令を読み込んだら、VMを終了させる。
+	if entry.handler == nil {
+		fmt.Printf("\nNot Implemented: %x", opCode)
+		e.Eip = 0
+		return
+	}
+	entry.handler(e)
+	e.addCycles(entry.cycles)
+	e.instrCount++
+}
+
+func (e *Emulator) Run(quiet bool) {
+	e.RunCycles(quiet, ^uint64(0))
+}
+
+// RunCycles はmaxCycles分だけ命令を実行すると呼び出し元に制御を返す。
+// デバイスのtick()と交互に呼び出すことで、命令実行とタイミングの
+// 合った周辺機器エミュレーションを組み合わせられる。
+// プログラムが終了した（実行可能な範囲を抜けた、またはEipが0になった）
+// 場合と、ブレークポイントの設定されたアドレスに到達して停止した場合は
+// falseを、maxCyclesに達しただけで続行可能な場合はtrueを返す。
+func (e *Emulator) RunCycles(quiet bool, maxCycles uint64) bool {
+	unlimited := maxCycles == ^uint64(0)
+	target := e.Cycles + maxCycles
+	first := true
+	for unlimited || e.Cycles < target {
+		if e.Eip >= e.MaxMemorySize {
+			return false
+		}
+		// 再開直後のEipにブレークポイントが残っていても即座に
+		// 止まり直さないよう、最初の1命令は必ず実行してから判定する。
+		if !first && e.hasBreakpoint(e.Eip) {
+			return false
+		}
+		first = false
+
+		if e.jitEnabled {
+			if block, ok := e.blockCache[e.Eip]; ok {
+				e.runBlock(block, quiet)
+				if e.Eip == 0x0 {
+					fmt.Printf("\nend of program.\n\n")
+					return false
+				}
+				continue
+			}
+		}
+
+		entryEip := e.Eip
+		code := e.GetCode8(0)
+		if !quiet {
+			inst := DecodeInstruction(e.Bus, e.Eip)
+			fmt.Printf("EIP = %x, %s\n", e.Eip, inst.String())
+		}
+		e.executeOpCode(code)
+		if e.jitEnabled {
+			e.recordEntry(entryEip)
+		}
+		if e.Eip == 0x0 {
+			fmt.Printf("\nend of program.\n\n")
+			return false
+		}
+	}
+	return true
+}
+
+// RunJIT はRunと同じ命令実行ループを使うが、jit.goのスレッデッドコード
+// ブロックキャッシュを有効にする。同じEIPにjitThreshold回入ると以降は
+// 1命令ずつのフェッチ・ModRMデコードではなく翻訳済みブロックを再生する。
+func (e *Emulator) RunJIT(quiet bool) {
+	e.jitEnabled = true
+	e.RunCycles(quiet, ^uint64(0))
+}
+
+// Step は1命令だけ実行する（executeOpCodeを1回呼ぶ）。GDBリモートシリアル
+// プロトコルの's'パケットなど、外部から1命令ずつ進めたい場合に使う。
+func (e *Emulator) Step(quiet bool) {
+	if e.Eip >= e.MaxMemorySize {
+		return
+	}
+	code := e.GetCode8(0)
+	if !quiet {
+		inst := DecodeInstruction(e.Bus, e.Eip)
+		fmt.Printf("EIP = %x, %s\n", e.Eip, inst.String())
+	}
+	e.executeOpCode(code)
+}
+
+// AtBreakpoint はEipに現在ソフトウェアブレークポイントが設定されているかを返す。
+func (e *Emulator) AtBreakpoint() bool {
+	return e.hasBreakpoint(e.Eip)
+}
+
+// Running はプログラムがまだ終了していない（Eipが有効な範囲内にある）かを返す。
+func (e *Emulator) Running() bool {
+	return e.Eip != 0 && e.Eip < e.MaxMemorySize
+}
+
+func NewEmulator(memorySize uint32, eip uint32, esp uint32, fileName string) (*Emulator, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, memorySize)
+	count := 0
+	for {
+		c, err := f.Read(buf)
+		if err == io.EOF {
+			count += c
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		count += c
+	}
+
+	b := bus.New(memorySize)
+	if err := b.LoadROM(0x7c00, buf[:count]); err != nil {
+		return nil, err
+	}
+	registerDevices(b)
+
+	emu := &Emulator{
+		Bus:           b,
+		Eip:           eip,
+		MaxMemorySize: memorySize,
+		startTime:     time.Now(),
+	}
+	emu.Registers[CEsp] = esp
+
+	return emu, nil
+}
+
+// registerDevices はこのエミュレータが想定する、典型的なPC互換機の周辺機器を
+// バスにマップする。UARTはシリアルコンソールとしてのIN/OUT、PIC/PITは
+// コマンド・マスクの保持のみ、CGAはテキストモードのビデオメモリとして動く。
+func registerDevices(b *bus.Bus) {
+	b.MapPort(0x03F8, device.NewUART16550())
+
+	b.MapPort(0x20, device.NewPIC())
+	b.MapPort(0xA0, device.NewPIC())
+
+	pit := device.NewPIT()
+	for port := uint16(0x40); port <= 0x43; port++ {
+		b.MapPort(port, pit)
+	}
+
+	b.MapMem(0xB8000, 0xB8000+device.CGATextBufferSize, device.NewCGATextBuffer(0xB8000))
+}
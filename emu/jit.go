@@ -0,0 +1,205 @@
+package emu
+
+import (
+	"fmt"
+	"time"
+)
+
+// jitThreshold は、あるEIPに何回到達したら基本ブロックを翻訳してキャッシュするかの閾値。
+// MAMEのdrcbex64などの動的再コンパイラにならい、ホットループだけを翻訳対象にする。
+const jitThreshold = 10
+
+// jitPageSize はblockPagesの粒度（無効化のための自己書き換えコード検出に使う）。
+const jitPageSize = 0x1000
+
+// Op は翻訳済み基本ブロック内の1命令を表す。execはその命令の実行本体への
+// クロージャで、オペコードディスパッチテーブルは翻訳時に一度だけ引く。
+// ModRMを伴う命令（0x01/0x3B/0x83/0x88/0x89/0x8A/0x8B/0xC7/0xFF）は翻訳時に
+// デコード済みのModRM（0xC7ではimm32も）を閉じ込めてあり、再生のたびに
+// ModRMバイトを読み直さない。それ以外の命令の即値と0x83のimm8は、
+// 通常のハンドラが再生のたびにメモリから読む。
+type Op struct {
+	exec   func(*Emulator)
+	cycles uint64
+}
+
+// Block は1つの基本ブロック（先頭から制御フロー命令までの連続した命令列）を
+// 翻訳した結果。startをキーにblockCacheに格納する。
+type Block struct {
+	start uint32
+	end   uint32 // 末尾の制御フロー命令を含む、このブロックが占めるバイト範囲の終端（exclusive）
+	ops   []Op
+}
+
+// translateBlock はstartから1つの基本ブロックを翻訳する。ModRMを伴う命令は
+// 実行本体（emulator.goの各xxxCore）だけを呼ぶクロージャにし、ModRMの再解釈を
+// 避ける。Jcc/JMP/CALL/RET/INTに行き着いたところでブロックを打ち切る。
+func (e *Emulator) translateBlock(start uint32) *Block {
+	block := &Block{start: start}
+	pos := start
+
+	for len(block.ops) < 4096 {
+		opCode := e.Bus.Read8(pos)
+		cycles := opcodeTable[opCode].cycles
+
+		switch opCode {
+		case 0x01:
+			m, n := decodeModRM(e.Bus, pos+1)
+			instrEnd := pos + 1 + n
+			block.ops = append(block.ops, Op{exec: func(e *Emulator) { e.Eip = instrEnd; e.addRm32R32Core(m) }, cycles: cycles})
+			pos = instrEnd
+
+		case 0x3B:
+			m, n := decodeModRM(e.Bus, pos+1)
+			instrEnd := pos + 1 + n
+			block.ops = append(block.ops, Op{exec: func(e *Emulator) { e.Eip = instrEnd; e.cmpR32Rm32Core(m) }, cycles: cycles})
+			pos = instrEnd
+
+		case 0x88:
+			m, n := decodeModRM(e.Bus, pos+1)
+			instrEnd := pos + 1 + n
+			block.ops = append(block.ops, Op{exec: func(e *Emulator) { e.Eip = instrEnd; e.movRm8R8Core(m) }, cycles: cycles})
+			pos = instrEnd
+
+		case 0x89:
+			m, n := decodeModRM(e.Bus, pos+1)
+			instrEnd := pos + 1 + n
+			block.ops = append(block.ops, Op{exec: func(e *Emulator) { e.Eip = instrEnd; e.movRm32R32Core(m) }, cycles: cycles})
+			pos = instrEnd
+
+		case 0x8A:
+			m, n := decodeModRM(e.Bus, pos+1)
+			instrEnd := pos + 1 + n
+			block.ops = append(block.ops, Op{exec: func(e *Emulator) { e.Eip = instrEnd; e.movR8Rm8Core(m) }, cycles: cycles})
+			pos = instrEnd
+
+		case 0x8B:
+			m, n := decodeModRM(e.Bus, pos+1)
+			instrEnd := pos + 1 + n
+			block.ops = append(block.ops, Op{exec: func(e *Emulator) { e.Eip = instrEnd; e.movR32Rm32Core(m) }, cycles: cycles})
+			pos = instrEnd
+
+		case 0xC7:
+			m, n := decodeModRM(e.Bus, pos+1)
+			afterModRM := pos + 1 + n
+			value := imm32At(e.Bus, afterModRM)
+			instrEnd := afterModRM + 4
+			block.ops = append(block.ops, Op{exec: func(e *Emulator) { e.Eip = instrEnd; e.movRm32Imm32Core(m, value) }, cycles: cycles})
+			pos = instrEnd
+
+		case 0x83:
+			m, n := decodeModRM(e.Bus, pos+1)
+			afterModRM := pos + 1 + n
+			sub := code83Table[m.Reg]
+			block.ops = append(block.ops, Op{exec: func(e *Emulator) { e.Eip = afterModRM; sub(e, m) }, cycles: cycles})
+			pos = afterModRM + 1 // サブハンドラ自身がimm8の1バイト分Eipを進める
+
+		case 0xFF:
+			m, n := decodeModRM(e.Bus, pos+1)
+			afterModRM := pos + 1 + n
+			sub := codeFFTable[m.Reg]
+			block.ops = append(block.ops, Op{exec: func(e *Emulator) { e.Eip = afterModRM; sub(e, m) }, cycles: cycles})
+			pos = afterModRM
+
+		case 0x70, 0x71, 0x72, 0x73, 0x74, 0x75, 0x78, 0x79, 0x7C, 0x7E,
+			0xE8, 0xE9, 0xEB, 0xC3, 0xCD:
+			// 制御フロー命令。Eipの更新は通常のハンドラに任せ、ブロックをここで終える。
+			handler := opcodeTable[opCode].handler
+			length := DecodeInstruction(e.Bus, pos).Length
+			block.ops = append(block.ops, Op{exec: handler, cycles: cycles})
+			block.end = pos + length
+			return block
+
+		default:
+			entry := opcodeTable[opCode]
+			if entry.handler == nil {
+				// 未実装オペコード。インタプリタと同じ「未実装」終了処理に委ね、
+				// ブロックはここで終わらせる。
+				block.ops = append(block.ops, Op{exec: func(e *Emulator) { e.executeOpCode(uint32(opCode)) }, cycles: 0})
+				block.end = pos + 1
+				return block
+			}
+			length := DecodeInstruction(e.Bus, pos).Length
+			block.ops = append(block.ops, Op{exec: entry.handler, cycles: cycles})
+			pos += length
+		}
+	}
+
+	// 4096命令を超えても制御フロー命令に行き着かない場合は、それ以上翻訳を
+	// 続けずここで打ち切る（通常のプログラムでは起こらない安全弁）。
+	block.end = pos
+	return block
+}
+
+// runBlock はblockのOpを順に再生する。各Opの実行本体はEmulatorの通常の
+// ハンドラ（のCore部分）そのものなので、レジスタ・メモリ・eflagsへの
+// 効果はインタプリタで1命令ずつ実行した場合と変わらない。
+func (e *Emulator) runBlock(block *Block, quiet bool) {
+	if !quiet {
+		fmt.Printf("EIP = %x, [jit block @ 0x%x, %d ops]\n", e.Eip, block.start, len(block.ops))
+	}
+	for _, op := range block.ops {
+		op.exec(e)
+		e.addCycles(op.cycles)
+		e.instrCount++
+	}
+}
+
+// recordEntry はeipへの到達回数を数え、jitThreshold回に達したら翻訳して
+// キャッシュする。RunCyclesがjitEnabledのときだけインタプリタ実行後に呼ぶ。
+func (e *Emulator) recordEntry(eip uint32) {
+	if e.entryCounts == nil {
+		e.entryCounts = make(map[uint32]uint32)
+	}
+	e.entryCounts[eip]++
+	if e.entryCounts[eip] < jitThreshold {
+		return
+	}
+	if _, ok := e.blockCache[eip]; ok {
+		return
+	}
+	if !e.jitEngaged {
+		e.jitEngaged = true
+		e.jitStartTime = time.Now()
+		e.jitStartInstrCount = e.instrCount
+	}
+	e.cacheBlock(e.translateBlock(eip))
+}
+
+// cacheBlock はblockをblockCacheに登録し、自己書き換えコード検出のために
+// blockが跨るページそれぞれへの逆引きもblockPagesに記録する。
+func (e *Emulator) cacheBlock(block *Block) {
+	if e.blockCache == nil {
+		e.blockCache = make(map[uint32]*Block)
+	}
+	if e.blockPages == nil {
+		e.blockPages = make(map[uint32][]uint32)
+	}
+	e.blockCache[block.start] = block
+
+	firstPage := block.start / jitPageSize
+	lastPage := (block.end - 1) / jitPageSize
+	for page := firstPage; page <= lastPage; page++ {
+		e.blockPages[page] = append(e.blockPages[page], block.start)
+	}
+}
+
+// invalidateBlocksCovering はaddrへの書き込みがあった際に呼ばれ、addrの
+// 属するページを跨ぐ翻訳済みブロックを破棄する。ページ単位の粗い粒度なので、
+// 同じページ内の無関係なコードも道連れで再翻訳対象になることがあるが、
+// 正しさを保つための安全側の選択。
+func (e *Emulator) invalidateBlocksCovering(addr uint32) {
+	if e.blockPages == nil {
+		return
+	}
+	page := addr / jitPageSize
+	starts, ok := e.blockPages[page]
+	if !ok {
+		return
+	}
+	for _, start := range starts {
+		delete(e.blockCache, start)
+		delete(e.entryCounts, start)
+	}
+	delete(e.blockPages, page)
+}
@@ -0,0 +1,39 @@
+package emu
+
+import (
+	"testing"
+
+	"otyaken/go-x86-emu/bus"
+)
+
+// TestWriteMemory8InvalidatesCachedBlock は、JIT有効時に翻訳済みブロックの
+// 範囲内へ書き込むとそのブロックがキャッシュから破棄されることを確認する。
+// debug.gdbstubの'M'パケットハンドラのように、実行経路を介さず直接
+// WriteMemory8を呼ぶ書き込みでも同じ保証が効かなければならない。
+func TestWriteMemory8InvalidatesCachedBlock(t *testing.T) {
+	e := &Emulator{Bus: bus.New(0x2000), jitEnabled: true}
+	e.cacheBlock(&Block{start: 0x100, end: 0x110})
+
+	if _, ok := e.blockCache[0x100]; !ok {
+		t.Fatal("block was not cached")
+	}
+
+	e.WriteMemory8(0x105, 0x90)
+
+	if _, ok := e.blockCache[0x100]; ok {
+		t.Error("WriteMemory8 into a cached block's range did not invalidate it")
+	}
+}
+
+// TestWriteMemory8LeavesUnrelatedPagesCached は、無効化がページ単位で
+// 行われ、書き込みと無関係なページのブロックまで巻き込まないことを確認する。
+func TestWriteMemory8LeavesUnrelatedPagesCached(t *testing.T) {
+	e := &Emulator{Bus: bus.New(0x3000), jitEnabled: true}
+	e.cacheBlock(&Block{start: 0x100, end: 0x110})
+
+	e.WriteMemory8(0x2000, 0x90)
+
+	if _, ok := e.blockCache[0x100]; !ok {
+		t.Error("write to an unrelated page invalidated a cached block it doesn't cover")
+	}
+}
@@ -0,0 +1,46 @@
+package emu
+
+import (
+	"testing"
+
+	"otyaken/go-x86-emu/bus"
+)
+
+// TestCalcMemoryAddressSibBaseFiveModZero はSIBのbase=5かつmod=0の特殊
+// ケース（ベースレジスタを使わずdisp32のみを使う）が正しく効くことを確認する。
+func TestCalcMemoryAddressSibBaseFiveModZero(t *testing.T) {
+	e := &Emulator{Bus: bus.New(0x1000)}
+	e.Registers[CEbp] = 0xdeadbeef // base=5はEBPだが、この特殊ケースでは無視される
+
+	// ModRM: mod=00, reg=000, rm=100(SIB) / SIB: scale=00, index=100(none), base=101
+	e.Bus.Write8(0, 0x04)
+	e.Bus.Write8(1, 0x25)
+	e.Bus.Write32(2, 0x12345678)
+
+	e.Eip = 0
+	m := e.ParseModrm()
+	addr := e.calcMemoryAddress(m)
+	if addr != 0x12345678 {
+		t.Errorf("calcMemoryAddress() = 0x%x, want 0x12345678 (base register must be ignored)", addr)
+	}
+}
+
+// TestCalcMemoryAddressSibWithIndex はbase/indexレジスタとscaleを組み合わせた
+// 通常のSIBアドレッシングを確認する。
+func TestCalcMemoryAddressSibWithIndex(t *testing.T) {
+	e := &Emulator{Bus: bus.New(0x1000)}
+	e.Registers[CEax] = 0x1000 // base
+	e.Registers[CEbx] = 0x2    // index
+
+	// ModRM: mod=00, reg=000, rm=100(SIB) / SIB: scale=10(<<2), index=011(EBX), base=000(EAX)
+	e.Bus.Write8(0, 0x04)
+	e.Bus.Write8(1, 0x98)
+
+	e.Eip = 0
+	m := e.ParseModrm()
+	addr := e.calcMemoryAddress(m)
+	want := uint32(0x1000) + (uint32(0x2) << 2)
+	if addr != want {
+		t.Errorf("calcMemoryAddress() = 0x%x, want 0x%x", addr, want)
+	}
+}
@@ -4,20 +4,75 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+
+	"otyaken/go-x86-emu/debug"
+	"otyaken/go-x86-emu/device"
+	"otyaken/go-x86-emu/disasm"
+	"otyaken/go-x86-emu/emu"
 )
 
 func main() {
 	var (
-		f = flag.String("f", "bin", "Filename")
-		q = flag.Bool("q", false, "quite")
+		f      = flag.String("f", "bin", "Filename")
+		q      = flag.Bool("q", false, "quite")
+		d      = flag.String("d", "", "Dump a static disassembly listing for start:end (hex addresses) instead of running")
+		gdb    = flag.String("gdb", "", "Wait for a GDB remote serial protocol connection on this address (e.g. :1234) instead of running immediately")
+		romMap = flag.String("rom-map", "", "Load additional ROM regions from a JSON map file ([{\"address\":\"0x...\",\"file\":\"...\"}])")
+		jit    = flag.Bool("jit", false, "Cache hot basic blocks as threaded Go closures instead of interpreting every instruction")
 	)
 	flag.Parse()
 	fmt.Println(*f)
 
-	emu, err := NewEmulator(1024*1024, 0x7c00, 0x7c00, *f)
+	e, err := emu.NewEmulator(1024*1024, 0x7c00, 0x7c00, *f)
 	if err != nil {
 		log.Fatal(err)
 	}
-	emu.Run(*q)
-	emu.DumpEmulator()
+
+	if *romMap != "" {
+		if err := device.LoadROMMap(e.Bus, *romMap); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *d != "" {
+		start, end, err := parseRange(*d)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(disasm.Listing(e.Bus, start, end))
+		return
+	}
+
+	if *gdb != "" {
+		if err := debug.Serve(*gdb, e, *q); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *jit {
+		e.RunJIT(*q)
+	} else {
+		e.Run(*q)
+	}
+	e.DumpEmulator()
+}
+
+// parseRange は"start:end"形式（16進数）の文字列をアドレスの範囲に変換する。
+func parseRange(s string) (start, end uint32, err error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q, expected start:end", s)
+	}
+	startVal, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	endVal, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint32(startVal), uint32(endVal), nil
 }